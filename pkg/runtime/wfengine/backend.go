@@ -36,6 +36,13 @@ type actorBackend struct {
 	actors                    actors.Actors
 	orchestrationWorkItemChan chan *backend.OrchestrationWorkItem
 	activityWorkItemChan      chan *backend.ActivityWorkItem
+
+	// eventPublisher, eventPublishingCfg, and eventFilter configure the
+	// optional CloudEvents lifecycle notifications described in events.go.
+	// They're nil/zero by default, which disables publishing entirely.
+	eventPublisher     EventPublisher
+	eventPublishingCfg EventPublishingConfig
+	eventFilter        map[string]bool
 }
 
 func NewActorBackend() *actorBackend {
@@ -51,6 +58,9 @@ func (be *actorBackend) SetActorRuntime(actors actors.Actors) {
 
 // ScheduleActivity implements workflowScheduler
 func (be *actorBackend) ScheduleActivity(wi *backend.ActivityWorkItem) {
+	if wi.NewEvent.GetTaskScheduled() != nil {
+		be.publishLifecycleEvent(context.Background(), string(wi.InstanceID), wi.NewEvent.GetTaskScheduled().GetName(), wi.NewEvent.GetEventId(), EventTypeActivityScheduled, wi.NewEvent)
+	}
 	be.activityWorkItemChan <- wi
 }
 
@@ -92,6 +102,7 @@ func (be *actorBackend) CreateOrchestrationInstance(ctx context.Context, e *back
 	if _, err := be.actors.Call(ctx, req); err != nil {
 		return err
 	}
+	be.publishLifecycleEvent(ctx, workflowInstanceID, e.GetExecutionStarted().GetName(), e.GetEventId(), EventTypeWorkflowStarted, e)
 	return nil
 }
 
@@ -118,42 +129,131 @@ func (be *actorBackend) GetOrchestrationMetadata(ctx context.Context, id api.Ins
 }
 
 // AbandonActivityWorkItem implements backend.Backend
-func (*actorBackend) AbandonActivityWorkItem(context.Context, *backend.ActivityWorkItem) error {
-	panic("unimplemented")
+//
+// This is called when the app fails to execute the work item, e.g. because
+// its app channel is unavailable. Signaling false on the callback channel,
+// rather than true, tells the actor to abandon this turn without
+// committing a completion event, so the activity will be retried.
+func (*actorBackend) AbandonActivityWorkItem(ctx context.Context, wi *backend.ActivityWorkItem) error {
+	wi.Properties[CallbackChannelProperty].(chan bool) <- false
+	return nil
 }
 
 // AbandonOrchestrationWorkItem implements backend.Backend
-func (*actorBackend) AbandonOrchestrationWorkItem(context.Context, *backend.OrchestrationWorkItem) error {
-	panic("unimplemented")
+//
+// See AbandonActivityWorkItem for why false is signaled here.
+func (*actorBackend) AbandonOrchestrationWorkItem(ctx context.Context, wi *backend.OrchestrationWorkItem) error {
+	wi.Properties[CallbackChannelProperty].(chan bool) <- false
+	return nil
 }
 
 // AddNewOrchestrationEvent implements backend.Backend
-func (*actorBackend) AddNewOrchestrationEvent(context.Context, api.InstanceID, *backend.HistoryEvent) error {
-	panic("unimplemented")
+//
+// This is used to deliver events to a running orchestration from outside
+// its normal execution turn, e.g. a termination request or an external
+// event raised by the app. The event is appended directly to the target
+// workflow actor's inbox, the same way CreateOrchestrationInstance appends
+// the initial ExecutionStartedEvent.
+func (be *actorBackend) AddNewOrchestrationEvent(ctx context.Context, id api.InstanceID, e *backend.HistoryEvent) error {
+	if err := be.validateConfiguration(); err != nil {
+		return err
+	}
+
+	eventData, err := backend.MarshalHistoryEvent(e)
+	if err != nil {
+		return err
+	}
+
+	req := invokev1.
+		NewInvokeMethodRequest(AddWorkflowEventMethod).
+		WithActor(WorkflowActorType, string(id)).
+		WithRawData(eventData, invokev1.OctetStreamContentType)
+	if _, err := be.actors.Call(ctx, req); err != nil {
+		return err
+	}
+
+	if eventType, ok := lifecycleEventTypeFor(e); ok {
+		be.publishLifecycleEvent(ctx, string(id), "", e.GetEventId(), eventType, e)
+	}
+	return nil
+}
+
+// lifecycleEventTypeFor maps the history events AddNewOrchestrationEvent can
+// deliver to the lifecycle notification type they represent.
+func lifecycleEventTypeFor(e *backend.HistoryEvent) (string, bool) {
+	switch {
+	case e.GetEventRaised() != nil:
+		return EventTypeExternalEventRaised, true
+	case e.GetTimerFired() != nil:
+		return EventTypeTimerFired, true
+	case e.GetExecutionTerminated() != nil:
+		return EventTypeWorkflowTerminated, true
+	default:
+		return "", false
+	}
 }
 
 // CompleteActivityWorkItem implements backend.Backend
-func (*actorBackend) CompleteActivityWorkItem(ctx context.Context, wi *backend.ActivityWorkItem) error {
-	// Resumes workflow execution code path in the actor
+func (be *actorBackend) CompleteActivityWorkItem(ctx context.Context, wi *backend.ActivityWorkItem) error {
+	// Resumes workflow execution code path in the actor, which persists the
+	// result. Only once that's done is it safe to publish: publishing
+	// before this point would announce a completion the actor might still
+	// fail to commit.
 	wi.Properties[CallbackChannelProperty].(chan bool) <- true
+
+	if wi.Result != nil {
+		be.publishLifecycleEvent(ctx, string(wi.InstanceID), "", wi.Result.GetEventId(), EventTypeActivityCompleted, wi.Result)
+	}
 	return nil
 }
 
 // CompleteOrchestrationWorkItem implements backend.Backend
-func (*actorBackend) CompleteOrchestrationWorkItem(ctx context.Context, wi *backend.OrchestrationWorkItem) error {
-	// Resumes workflow execution code path in the actor
+func (be *actorBackend) CompleteOrchestrationWorkItem(ctx context.Context, wi *backend.OrchestrationWorkItem) error {
+	// Resumes workflow execution code path in the actor, which persists the
+	// new events. Only once that's done is it safe to publish them.
 	wi.Properties[CallbackChannelProperty].(chan bool) <- true
+
+	be.publishOrchestrationCompletionEvents(ctx, wi)
 	return nil
 }
 
+// publishOrchestrationCompletionEvents inspects the new events produced by
+// this turn for a terminal ExecutionCompletedEvent and, if found, publishes
+// the matching WorkflowCompleted/WorkflowFailed lifecycle notification.
+// Explicit termination requested through AddNewOrchestrationEvent is
+// published there, since that's where the TerminateEvent is appended to
+// history. The terminations a schedule actor sends under OverlapCancelOther
+// go straight to the workflow actor and are not published.
+func (be *actorBackend) publishOrchestrationCompletionEvents(ctx context.Context, wi *backend.OrchestrationWorkItem) {
+	if wi.State == nil {
+		return
+	}
+	for _, e := range wi.State.NewEvents() {
+		completed := e.GetExecutionCompleted()
+		if completed == nil {
+			continue
+		}
+		eventType := EventTypeWorkflowCompleted
+		if completed.GetOrchestrationStatus() == api.OrchestrationStatus_ORCHESTRATION_STATUS_FAILED {
+			eventType = EventTypeWorkflowFailed
+		}
+		be.publishLifecycleEvent(ctx, string(wi.InstanceID), "", e.GetEventId(), eventType, e)
+	}
+}
+
 // CreateTaskHub implements backend.Backend
 func (*actorBackend) CreateTaskHub(context.Context) error {
 	return nil
 }
 
 // DeleteTaskHub implements backend.Backend
+//
+// Actor-backed task hubs have no separate storage to tear down: workflow
+// and activity state lives in the actors themselves and is reclaimed by the
+// actor runtime's normal garbage collection as instances complete, so there
+// is nothing for this backend to do beyond acknowledging the call.
 func (*actorBackend) DeleteTaskHub(context.Context) error {
-	panic("unimplemented")
+	return nil
 }
 
 // GetActivityWorkItem implements backend.Backend
@@ -168,8 +268,13 @@ func (be *actorBackend) GetActivityWorkItem(ctx context.Context) (*backend.Activ
 }
 
 // GetOrchestrationRuntimeState implements backend.Backend
-func (*actorBackend) GetOrchestrationRuntimeState(context.Context, *backend.OrchestrationWorkItem) (*backend.OrchestrationRuntimeState, error) {
-	panic("unimplemented")
+func (be *actorBackend) GetOrchestrationRuntimeState(ctx context.Context, wi *backend.OrchestrationWorkItem) (*backend.OrchestrationRuntimeState, error) {
+	id := wi.InstanceID
+	history, err := be.getOrchestrationHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return backend.NewOrchestrationRuntimeState(id, history), nil
 }
 
 // GetOrchestrationWorkItem implements backend.Backend
@@ -198,9 +303,41 @@ func (be *actorBackend) String() string {
 	return fmt.Sprintf("dapr.actors/v1-alpha")
 }
 
+// GetWorkflowHistoryMethod is the existing workflow actor method that
+// returns the raw, ordered history events the actor has accumulated for its
+// instance.
+const GetWorkflowHistoryMethod = "GetWorkflowHistory"
+
+// getOrchestrationHistory invokes the workflow actor for id and decodes its
+// raw history, shared by GetOrchestrationRuntimeState and the workflow
+// shadower.
+func (be *actorBackend) getOrchestrationHistory(ctx context.Context, id api.InstanceID) ([]*backend.HistoryEvent, error) {
+	if err := be.validateConfiguration(); err != nil {
+		return nil, err
+	}
+
+	req := invokev1.
+		NewInvokeMethodRequest(GetWorkflowHistoryMethod).
+		WithActor(WorkflowActorType, string(id)).
+		WithRawData(nil, invokev1.OctetStreamContentType)
+	res, err := be.actors.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	_, data := res.RawData()
+	if len(data) == 0 {
+		return nil, api.ErrInstanceNotFound
+	}
+	var history []*backend.HistoryEvent
+	if err := actors.DecodeInternalActorResponse(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to decode the internal actor response: %w", err)
+	}
+	return history, nil
+}
+
 func (be *actorBackend) validateConfiguration() error {
 	if be.actors == nil {
 		return errors.New("actor runtime has not been configured")
 	}
 	return nil
-}
\ No newline at end of file
+}
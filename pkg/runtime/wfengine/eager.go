@@ -0,0 +1,215 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/microsoft/durabletask-go/api"
+	"github.com/microsoft/durabletask-go/backend"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/dapr/dapr/pkg/actors"
+	invokev1 "github.com/dapr/dapr/pkg/messaging/v1"
+)
+
+// CreateWorkflowInstanceEagerMethod is the workflow actor method invoked
+// when CreateOptions.Eager is set. Unlike CreateWorkflowInstanceMethod, the
+// actor runs the first orchestration turn synchronously, as part of
+// handling this call, if and only if this replica is the one hosting the
+// actor's activation. The actor falls back to its normal behavior --
+// persisting the ExecutionStartedEvent and relying on a reminder to drive
+// the first turn -- whenever it can't determine that locally, e.g. right
+// after activation on a cold start.
+const CreateWorkflowInstanceEagerMethod = "CreateWorkflowInstanceEager"
+
+// ReuseIDPolicy controls what happens when CreateOrchestrationInstanceEager
+// is called with an instance ID that already exists.
+// CreateOrchestrationInstance takes no ReuseIDPolicy.
+type ReuseIDPolicy int
+
+const (
+	// ReuseIDPolicyError rejects the create request outright.
+	ReuseIDPolicyError ReuseIDPolicy = iota
+	// ReuseIDPolicyIgnore silently reuses the existing instance, returning
+	// its current metadata instead of starting a new run.
+	ReuseIDPolicyIgnore
+	// ReuseIDPolicyTerminateAndReuse terminates the existing instance, if
+	// it's still running, and starts a new run under the same ID.
+	ReuseIDPolicyTerminateAndReuse
+)
+
+// CreateOptions customizes how CreateOrchestrationInstanceEager creates a
+// new workflow instance.
+type CreateOptions struct {
+	// Eager requests the eager-start fast path: the first orchestration
+	// turn runs synchronously as part of the create call whenever the
+	// target actor happens to be hosted on the replica that receives it.
+	// When false, or when the fast path isn't available, this call behaves
+	// like CreateOrchestrationInstance, except that ReuseIDPolicy is still
+	// enforced.
+	Eager bool
+	// ReuseIDPolicy governs what happens when the instance ID is already
+	// in use.
+	ReuseIDPolicy ReuseIDPolicy
+	// InitialInput is the serialized input passed to the new instance. It's
+	// redundant with the input already carried by the ExecutionStartedEvent
+	// passed to CreateOrchestrationInstanceEager, and is only consulted
+	// when that event's input is empty, so callers building the event by
+	// hand have a simpler way to set it.
+	InitialInput string
+}
+
+// eagerCreateRequest is the wire payload sent to
+// CreateWorkflowInstanceEagerMethod.
+type eagerCreateRequest struct {
+	StartEvent    []byte
+	ReuseIDPolicy ReuseIDPolicy
+	InitialInput  string
+}
+
+// EagerBackend is implemented by backends that support the eager-start fast
+// path. actorBackend implements it; backends without a notion of actor
+// placement can omit it, in which case callers should fall back to the
+// plain CreateOrchestrationInstance call.
+//
+// Threading Eager through the workflow client API, alongside the existing
+// gRPC/HTTP create-instance endpoints, is separate, outer wiring that isn't
+// implemented in this package.
+type EagerBackend interface {
+	// CreateOrchestrationInstanceEager behaves like
+	// backend.Backend.CreateOrchestrationInstance, except that it returns
+	// the new instance's metadata directly when the eager-start fast path
+	// was taken. The returned metadata is nil when the instance was created
+	// the normal way and the caller should poll GetOrchestrationMetadata as
+	// usual. When ReuseIDPolicyIgnore finds an existing instance, no
+	// instance is created and that instance's current metadata is returned.
+	CreateOrchestrationInstanceEager(ctx context.Context, e *backend.HistoryEvent, opts CreateOptions) (*api.OrchestrationMetadata, error)
+}
+
+// CreateOrchestrationInstanceEager implements EagerBackend.
+func (be *actorBackend) CreateOrchestrationInstanceEager(ctx context.Context, e *backend.HistoryEvent, opts CreateOptions) (*api.OrchestrationMetadata, error) {
+	if err := be.validateConfiguration(); err != nil {
+		return nil, err
+	}
+
+	es := e.GetExecutionStarted()
+	if es == nil {
+		return nil, errors.New("the history event must be an ExecutionStartedEvent")
+	}
+	oi := es.GetOrchestrationInstance()
+	if oi == nil {
+		return nil, errors.New("the ExecutionStartedEvent did not contain orchestration instance information")
+	}
+	workflowInstanceID := oi.GetInstanceId()
+
+	if opts.InitialInput != "" && es.GetInput() == nil {
+		es.Input = wrapperspb.String(opts.InitialInput)
+	}
+
+	if !opts.Eager {
+		// CreateOrchestrationInstance implements the plain
+		// backend.Backend.CreateOrchestrationInstance contract and takes no
+		// CreateOptions of its own, so ReuseIDPolicy has to be enforced here
+		// first -- the same way the eager path below has the actor enforce
+		// it as part of eagerCreateRequest -- rather than silently falling
+		// back to ReuseIDPolicyError's ordinary create-fails-on-duplicate
+		// behavior for every policy.
+		if opts.ReuseIDPolicy != ReuseIDPolicyError {
+			skip, err := be.applyReuseIDPolicy(ctx, workflowInstanceID, opts.ReuseIDPolicy)
+			if err != nil {
+				return nil, err
+			}
+			if skip {
+				return be.GetOrchestrationMetadata(ctx, api.InstanceID(workflowInstanceID))
+			}
+		}
+		return nil, be.CreateOrchestrationInstance(ctx, e)
+	}
+
+	eventData, err := backend.MarshalHistoryEvent(e)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := actors.EncodeInternalActorRequest(eagerCreateRequest{
+		StartEvent:    eventData,
+		ReuseIDPolicy: opts.ReuseIDPolicy,
+		InitialInput:  opts.InitialInput,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode eager create request: %w", err)
+	}
+
+	req := invokev1.
+		NewInvokeMethodRequest(CreateWorkflowInstanceEagerMethod).
+		WithActor(WorkflowActorType, workflowInstanceID).
+		WithRawData(payload, invokev1.OctetStreamContentType)
+	res, err := be.actors.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ExecutionStartedEvent is durably persisted by the actor as part
+	// of handling this call whether or not it also ran the first turn
+	// eagerly, so the WorkflowStarted notification belongs here either way
+	// -- matching CreateOrchestrationInstance, which publishes right after
+	// its own equivalent actor call succeeds.
+	be.publishLifecycleEvent(ctx, workflowInstanceID, es.GetName(), e.GetEventId(), EventTypeWorkflowStarted, e)
+
+	_, data := res.RawData()
+	if len(data) == 0 {
+		// The actor fell back to the reminder-driven flow, e.g. because it
+		// wasn't activated locally. The instance still exists; the caller
+		// should poll GetOrchestrationMetadata the normal way.
+		return nil, nil
+	}
+
+	var metadata api.OrchestrationMetadata
+	if err := actors.DecodeInternalActorResponse(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode the internal actor response: %w", err)
+	}
+	return &metadata, nil
+}
+
+// applyReuseIDPolicy enforces a non-default ReuseIDPolicy against any
+// existing instance sharing workflowInstanceID, for callers of the
+// non-eager path of CreateOrchestrationInstanceEager. skip reports whether
+// the caller should stop and reuse the existing instance's metadata rather
+// than proceed to create a new run.
+func (be *actorBackend) applyReuseIDPolicy(ctx context.Context, workflowInstanceID string, policy ReuseIDPolicy) (skip bool, err error) {
+	existing, err := be.GetOrchestrationMetadata(ctx, api.InstanceID(workflowInstanceID))
+	if err != nil {
+		if errors.Is(err, api.ErrInstanceNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	switch policy {
+	case ReuseIDPolicyIgnore:
+		return true, nil
+	case ReuseIDPolicyTerminateAndReuse:
+		if existing.IsComplete() {
+			return false, nil
+		}
+		terminateEvent := backend.NewExecutionTerminatedEvent(wrapperspb.String("superseded by CreateOrchestrationInstanceEager with ReuseIDPolicyTerminateAndReuse"))
+		return false, be.AddNewOrchestrationEvent(ctx, api.InstanceID(workflowInstanceID), terminateEvent)
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/microsoft/durabletask-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEagerStartEvent(instanceID string) *backend.HistoryEvent {
+	return backend.NewExecutionStartedEvent(-1, "MyWorkflow", instanceID, nil, nil, nil)
+}
+
+// TestCreateOrchestrationInstanceEager_NonEagerFailsLikeCreate verifies that,
+// with no actor runtime configured, opts.Eager == false fails with the same
+// configuration error CreateOrchestrationInstance returns. Both methods
+// check the configuration before anything else, so this does not by itself
+// show that the non-eager path delegates to CreateOrchestrationInstance.
+func TestCreateOrchestrationInstanceEager_NonEagerFailsLikeCreate(t *testing.T) {
+	be := NewActorBackend()
+	e := newEagerStartEvent("test-instance")
+
+	// No actor runtime is configured, so both calls must fail with the same
+	// configuration error.
+	_, err := be.CreateOrchestrationInstanceEager(context.Background(), e, CreateOptions{Eager: false})
+	require.Error(t, err)
+
+	err2 := be.CreateOrchestrationInstance(context.Background(), e)
+	require.Error(t, err2)
+	assert.Equal(t, err2.Error(), err.Error())
+}
+
+func TestCreateOrchestrationInstanceEager_RejectsNonStartEvent(t *testing.T) {
+	be := NewActorBackend()
+	_, err := be.CreateOrchestrationInstanceEager(context.Background(), &backend.HistoryEvent{}, CreateOptions{Eager: true})
+	assert.Error(t, err)
+}
+
+// TestCreateOrchestrationInstanceEager_NonEagerReuseIDPolicyNeedsRuntime
+// verifies that a non-default ReuseIDPolicy on the non-eager path returns an
+// error when no actor runtime is configured. The configuration check runs
+// before the ReuseIDPolicy lookup, so this does not reach
+// applyReuseIDPolicy itself.
+func TestCreateOrchestrationInstanceEager_NonEagerReuseIDPolicyNeedsRuntime(t *testing.T) {
+	be := NewActorBackend()
+	e := newEagerStartEvent("test-instance")
+
+	_, err := be.CreateOrchestrationInstanceEager(context.Background(), e, CreateOptions{
+		Eager:         false,
+		ReuseIDPolicy: ReuseIDPolicyIgnore,
+	})
+	require.Error(t, err)
+}
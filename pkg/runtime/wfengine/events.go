@@ -0,0 +1,166 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/microsoft/durabletask-go/backend"
+
+	contribpubsub "github.com/dapr/components-contrib/pubsub"
+	"github.com/dapr/kit/logger"
+)
+
+// Lifecycle event types, used as the CloudEvent "type" field for workflow
+// notifications published to the configured pub/sub component. When the
+// workflow name is known, it is appended to the type (see
+// workflowEventCEType); filtering always uses these constants as they are.
+const (
+	EventTypeWorkflowStarted     = "com.dapr.workflow.started"
+	EventTypeWorkflowCompleted   = "com.dapr.workflow.completed"
+	EventTypeWorkflowFailed      = "com.dapr.workflow.failed"
+	EventTypeWorkflowTerminated  = "com.dapr.workflow.terminated"
+	EventTypeActivityScheduled   = "com.dapr.workflow.activity.scheduled"
+	EventTypeActivityCompleted   = "com.dapr.workflow.activity.completed"
+	EventTypeExternalEventRaised = "com.dapr.workflow.event.raised"
+	EventTypeTimerFired          = "com.dapr.workflow.timer.fired"
+)
+
+// cloudEventSpecVersion is the CloudEvents spec version these notifications
+// are encoded with.
+const cloudEventSpecVersion = "1.0"
+
+// lifecycleEvent is the JSON wire shape of a workflow lifecycle
+// notification, following the CloudEvents 1.0 core attributes.
+type lifecycleEvent struct {
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	SpecVersion     string          `json:"specversion"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// EventPublisher is the narrow slice of contribpubsub.PubSub that
+// publishing lifecycle events needs. Accepting this instead of the full
+// PubSub interface keeps the backend decoupled from the rest of a pub/sub
+// component's lifecycle (Init, Subscribe, Close, Features) it never
+// touches, and lets tests substitute a trivial fake instead of a full
+// component implementation.
+type EventPublisher interface {
+	Publish(req *contribpubsub.PublishRequest) error
+}
+
+// EventPublishingConfig configures the pub/sub topic workflow lifecycle
+// notifications are published to. It mirrors the "eventPubsub", "eventTopic",
+// and "eventFilter" properties read from the workflow component's metadata.
+type EventPublishingConfig struct {
+	// Pubsub is the name of the Dapr pub/sub component to publish to. An
+	// empty value disables lifecycle event publishing entirely.
+	Pubsub string
+	// Topic is the topic lifecycle notifications are published to.
+	Topic string
+	// Filter, if non-empty, restricts publishing to only these event types
+	// (see the EventType* constants). An empty filter publishes all of
+	// them.
+	Filter []string
+}
+
+// SetEventPublishing wires a pub/sub component into the backend so it
+// publishes CloudEvents-formatted workflow lifecycle notifications as
+// orchestrations progress. Passing a nil publisher or an empty
+// cfg.Pubsub disables publishing.
+func (be *actorBackend) SetEventPublishing(publisher EventPublisher, cfg EventPublishingConfig) {
+	be.eventPublisher = publisher
+	be.eventPublishingCfg = cfg
+	be.eventFilter = make(map[string]bool, len(cfg.Filter))
+	for _, t := range cfg.Filter {
+		be.eventFilter[t] = true
+	}
+}
+
+// publishLifecycleEvent publishes a single lifecycle notification, if
+// publishing is configured and eventType isn't excluded by the filter. The
+// event ID is derived from (instanceID, historySequenceNumber) so that
+// at-least-once redelivery by the pub/sub component is safe for idempotent
+// consumers.
+//
+// Errors are logged rather than returned: a lifecycle notification failing
+// to publish must never fail, retry, or roll back the workflow turn that
+// produced it.
+func (be *actorBackend) publishLifecycleEvent(ctx context.Context, instanceID string, workflowType string, historySequenceNumber int64, eventType string, payload *backend.HistoryEvent) {
+	if be.eventPublisher == nil || be.eventPublishingCfg.Pubsub == "" {
+		return
+	}
+	if len(be.eventFilter) > 0 && !be.eventFilter[eventType] {
+		return
+	}
+
+	data, err := backend.MarshalHistoryEvent(payload)
+	if err != nil {
+		log.Warnf("workflow events: failed to marshal %s for instance %s: %v", eventType, instanceID, err)
+		return
+	}
+
+	ce := lifecycleEvent{
+		ID:              fmt.Sprintf("%s-%d", instanceID, historySequenceNumber),
+		Source:          "dapr.internal.wfengine",
+		SpecVersion:     cloudEventSpecVersion,
+		Type:            workflowEventCEType(eventType, workflowType),
+		Subject:         instanceID,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+	ceBytes, err := json.Marshal(ce)
+	if err != nil {
+		log.Warnf("workflow events: failed to marshal CloudEvent envelope for instance %s: %v", instanceID, err)
+		return
+	}
+
+	req := &contribpubsub.PublishRequest{
+		PubsubName:  be.eventPublishingCfg.Pubsub,
+		Topic:       be.eventPublishingCfg.Topic,
+		Data:        ceBytes,
+		ContentType: ptrString("application/cloudevents+json"),
+		Metadata: map[string]string{
+			"cloudevent.id": ce.ID,
+		},
+	}
+	if err := be.eventPublisher.Publish(req); err != nil {
+		log.Warnf("workflow events: failed to publish %s for instance %s: %v", eventType, instanceID, err)
+	}
+}
+
+// workflowEventCEType allows the CloudEvent "type" to distinguish by
+// workflow function name without changing the stable EventType* constant
+// used for filtering.
+func workflowEventCEType(eventType, workflowType string) string {
+	if workflowType == "" {
+		return eventType
+	}
+	return fmt.Sprintf("%s.%s", eventType, workflowType)
+}
+
+func ptrString(s string) *string {
+	return &s
+}
+
+var log = logger.NewLogger("dapr.runtime.wfengine")
@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/microsoft/durabletask-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	contribpubsub "github.com/dapr/components-contrib/pubsub"
+)
+
+// recordingPubSub is a fake EventPublisher that just appends every
+// Publish call to a slice, so tests can assert both that a publish
+// happened and when it happened relative to other events.
+type recordingPubSub struct {
+	mu        sync.Mutex
+	published []*contribpubsub.PublishRequest
+}
+
+func (r *recordingPubSub) Publish(req *contribpubsub.PublishRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.published = append(r.published, req)
+	return nil
+}
+
+func (r *recordingPubSub) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.published)
+}
+
+func newTestBackendWithRecordingPubSub() (*actorBackend, *recordingPubSub) {
+	be := NewActorBackend()
+	pub := &recordingPubSub{}
+	be.SetEventPublishing(pub, EventPublishingConfig{Pubsub: "test-pubsub", Topic: "workflow-events"})
+	return be, pub
+}
+
+// TestCompleteActivityWorkItem_PublishesAfterCallbackSignal verifies the
+// lifecycle event for activity completion is only published after the
+// actor has been signaled to persist the result, not before.
+func TestCompleteActivityWorkItem_PublishesAfterCallbackSignal(t *testing.T) {
+	be, pub := newTestBackendWithRecordingPubSub()
+
+	var mu sync.Mutex
+	var order []string
+
+	callback := make(chan bool, 1)
+	done := make(chan struct{})
+	go func() {
+		<-callback
+		mu.Lock()
+		order = append(order, "persisted")
+		mu.Unlock()
+		close(done)
+	}()
+
+	wi := &backend.ActivityWorkItem{
+		InstanceID: "test-instance",
+		Result:     backend.NewTaskCompletedEvent(1, nil),
+		Properties: map[string]interface{}{
+			CallbackChannelProperty: callback,
+		},
+	}
+
+	// Wrap the recording pubsub so we can observe ordering relative to the
+	// callback signal.
+	origPublish := pub
+	be.eventPublisher = recordOrderPubSub{recordingPubSub: origPublish, mu: &mu, order: &order}
+
+	require.NoError(t, be.CompleteActivityWorkItem(context.Background(), wi))
+	<-done
+
+	require.Equal(t, []string{"persisted", "published"}, order)
+}
+
+// recordOrderPubSub decorates recordingPubSub to additionally append
+// "published" to a shared, ordered log, so tests can assert publish
+// happened strictly after some other event was logged.
+type recordOrderPubSub struct {
+	*recordingPubSub
+	mu    *sync.Mutex
+	order *[]string
+}
+
+func (r recordOrderPubSub) Publish(req *contribpubsub.PublishRequest) error {
+	r.mu.Lock()
+	*r.order = append(*r.order, "published")
+	r.mu.Unlock()
+	return r.recordingPubSub.Publish(req)
+}
+
+func TestPublishLifecycleEvent_SkipsWhenFilteredOut(t *testing.T) {
+	be, pub := newTestBackendWithRecordingPubSub()
+	be.eventFilter = map[string]bool{EventTypeWorkflowStarted: true}
+
+	be.publishLifecycleEvent(context.Background(), "i1", "MyWorkflow", 1, EventTypeActivityCompleted, backend.NewTaskCompletedEvent(1, nil))
+	assert.Equal(t, 0, pub.count())
+
+	be.publishLifecycleEvent(context.Background(), "i1", "MyWorkflow", 2, EventTypeWorkflowStarted, backend.NewTaskCompletedEvent(2, nil))
+	assert.Equal(t, 1, pub.count())
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/microsoft/durabletask-go/backend"
+
+	"github.com/dapr/dapr/pkg/actors"
+)
+
+// DefaultBackendName is the name under which actorBackend registers itself,
+// and the name selected when a workflow component doesn't configure a
+// backend explicitly.
+const DefaultBackendName = "actor"
+
+// BackendConfig carries everything a backend.Backend factory needs to
+// construct a backend instance. It's deliberately small today, but gives
+// alternate backends (in-memory, SQLite, Redis-streams, ...) a single place
+// to receive the actor runtime handle and any backend-specific metadata
+// from the workflow component's spec, without changing the factory
+// function's signature every time a new backend needs something new.
+type BackendConfig struct {
+	// Actors is the actor runtime handle. Actor-backed implementations need
+	// it to invoke actor methods; other implementations may ignore it.
+	Actors actors.Actors
+
+	// Metadata holds the workflow component's metadata properties verbatim,
+	// so a backend can read its own backend-specific configuration (e.g.
+	// a connection string) without the registry needing to know about it.
+	Metadata map[string]string
+}
+
+// BackendFactory constructs a backend.Backend from a BackendConfig.
+type BackendFactory func(BackendConfig) (backend.Backend, error)
+
+var (
+	backendRegistryMu sync.RWMutex
+	backendRegistry   = map[string]BackendFactory{}
+)
+
+func init() {
+	RegisterBackend(DefaultBackendName, func(cfg BackendConfig) (backend.Backend, error) {
+		be := NewActorBackend()
+		be.SetActorRuntime(cfg.Actors)
+		return be, nil
+	})
+}
+
+// RegisterBackend makes a backend.Backend implementation available under
+// name for selection via a workflow component's "backend" metadata
+// property. Registering the same name twice overwrites the previous
+// registration; this is intentional, as it lets a process substitute a test
+// double for a built-in backend without forking this package.
+//
+// RegisterBackend is expected to be called from init() functions, following
+// the same pattern as Terraform's backend/init factory map.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendRegistryMu.Lock()
+	defer backendRegistryMu.Unlock()
+	backendRegistry[name] = factory
+}
+
+// NewBackend constructs the backend registered under name. It returns an
+// error if no backend was registered under that name.
+func NewBackend(name string, cfg BackendConfig) (backend.Backend, error) {
+	backendRegistryMu.RLock()
+	factory, ok := backendRegistry[name]
+	backendRegistryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no workflow backend is registered under the name %q", name)
+	}
+	return factory(cfg)
+}
+
+// BackendMetadataKey is the workflow component metadata property that
+// selects a backend by name. Components that don't set it get
+// DefaultBackendName.
+const BackendMetadataKey = "backend"
+
+// NewBackendFromMetadata is the entry point the workflow component uses to
+// construct its backend: it reads BackendMetadataKey out of the component's
+// metadata to select a registered factory, defaulting to
+// DefaultBackendName when the property is absent, and passes the rest of
+// metadata straight through via BackendConfig.Metadata so the selected
+// backend can read its own backend-specific properties.
+func NewBackendFromMetadata(actors actors.Actors, metadata map[string]string) (backend.Backend, error) {
+	name := metadata[BackendMetadataKey]
+	if name == "" {
+		name = DefaultBackendName
+	}
+	return NewBackend(name, BackendConfig{Actors: actors, Metadata: metadata})
+}
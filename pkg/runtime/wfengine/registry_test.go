@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"testing"
+
+	"github.com/microsoft/durabletask-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBackendFromMetadata_DefaultsToActorBackend(t *testing.T) {
+	be, err := NewBackendFromMetadata(nil, map[string]string{})
+	require.NoError(t, err)
+	assert.IsType(t, &actorBackend{}, be)
+}
+
+func TestNewBackendFromMetadata_SelectsRegisteredBackend(t *testing.T) {
+	const testBackendName = "test-fake"
+	called := false
+	RegisterBackend(testBackendName, func(cfg BackendConfig) (backend.Backend, error) {
+		called = true
+		assert.Equal(t, "bar", cfg.Metadata["foo"])
+		return NewActorBackend(), nil
+	})
+
+	_, err := NewBackendFromMetadata(nil, map[string]string{
+		BackendMetadataKey: testBackendName,
+		"foo":              "bar",
+	})
+	require.NoError(t, err)
+	assert.True(t, called)
+}
+
+func TestNewBackendFromMetadata_UnknownBackend(t *testing.T) {
+	_, err := NewBackendFromMetadata(nil, map[string]string{BackendMetadataKey: "does-not-exist"})
+	assert.Error(t, err)
+}
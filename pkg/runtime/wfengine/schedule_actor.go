@@ -0,0 +1,588 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/microsoft/durabletask-go/api"
+	"github.com/microsoft/durabletask-go/backend"
+	"github.com/robfig/cron/v3"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/dapr/dapr/pkg/actors"
+	invokev1 "github.com/dapr/dapr/pkg/messaging/v1"
+)
+
+// AddWorkflowEventMethod is the existing workflow actor method used to
+// append a new history event (e.g. a termination request) to a running
+// instance's inbox.
+const AddWorkflowEventMethod = "AddWorkflowEvent"
+
+// scheduleReminderName is the single reminder every schedule actor keeps
+// registered for its next computed fire time. The actor re-registers it
+// with a new due time after every firing.
+const scheduleReminderName = "schedule-fire"
+
+// maxRecentResults bounds how many ScheduleActionResult entries a schedule
+// actor keeps, to stop its state from growing unbounded on long-lived,
+// frequently-firing schedules.
+const maxRecentResults = 20
+
+// scheduleStateKey is the single actor-state key a schedule actor keeps its
+// entire state under. A schedule actor is deactivated on idle timeout like
+// any other actor and can reactivate on a different replica, so every
+// method and reminder invocation loads this state before acting and saves
+// it back after any mutation; nothing is allowed to live only in the
+// in-memory struct fields.
+const scheduleStateKey = "schedule-state"
+
+// scheduleState is the durable, JSON-encoded representation of a
+// scheduleActor's fields, persisted via the actor runtime's state store.
+type scheduleState struct {
+	Spec    ScheduleSpec
+	Policy  SchedulePolicy
+	Action  ScheduleAction
+	Paused  bool
+	Running []api.InstanceID
+	Results []ScheduleActionResult
+	Pending []time.Time
+}
+
+// scheduleActor is the internal actor implementation backing
+// ScheduleActorType. One instance exists per schedule ID. It persists the
+// schedule's spec, policy, action, pause state, the instance IDs of
+// workflows it believes are still running, and a rolling window of recent
+// firing results, under scheduleStateKey in actor state.
+//
+// It mirrors the structure of the workflow actor: actor methods load state,
+// mutate it synchronously, save it back, and InvokeReminder drives the only
+// asynchronous behavior (computing and acting on the next fire time).
+type scheduleActor struct {
+	actors actors.Actors
+
+	scheduleID string
+	spec       ScheduleSpec
+	policy     SchedulePolicy
+	action     ScheduleAction
+	paused     bool
+	running    []api.InstanceID
+	results    []ScheduleActionResult
+
+	// pending holds fire times that arrived while the overlap policy
+	// blocked an immediate start, under OverlapBufferOne and
+	// OverlapBufferAll. It's drained, oldest first, the next time fire()
+	// finds the policy allows a start.
+	pending []time.Time
+}
+
+func newScheduleActor() *scheduleActor {
+	return &scheduleActor{}
+}
+
+// SetActorRuntime implements actors.InternalActor.
+func (a *scheduleActor) SetActorRuntime(runtime actors.Actors) {
+	a.actors = runtime
+}
+
+// InvokeMethod implements actors.InternalActor. It dispatches to the
+// schedule lifecycle methods exposed through ScheduleBackend.
+func (a *scheduleActor) InvokeMethod(ctx context.Context, actorID, methodName string, data []byte) ([]byte, error) {
+	a.scheduleID = actorID
+	if err := a.loadState(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load schedule state: %w", err)
+	}
+
+	switch methodName {
+	case CreateScheduleMethod:
+		var req CreateScheduleRequest
+		if err := actors.DecodeInternalActorRequest(data, &req); err != nil {
+			return nil, fmt.Errorf("failed to decode CreateSchedule request: %w", err)
+		}
+		if existing, err := a.actors.GetState(ctx, &actors.GetStateRequest{
+			ActorType: ScheduleActorType,
+			ActorID:   a.scheduleID,
+			Key:       scheduleStateKey,
+		}); err != nil {
+			return nil, err
+		} else if existing != nil && len(existing.Data) > 0 {
+			return nil, fmt.Errorf("schedule %q already exists", a.scheduleID)
+		}
+		if err := a.create(ctx, &req); err != nil {
+			return nil, err
+		}
+		return nil, a.saveState(ctx)
+	case UpdateScheduleMethod:
+		var req UpdateScheduleRequest
+		if err := actors.DecodeInternalActorRequest(data, &req); err != nil {
+			return nil, fmt.Errorf("failed to decode UpdateSchedule request: %w", err)
+		}
+		if err := a.update(ctx, &req); err != nil {
+			return nil, err
+		}
+		return nil, a.saveState(ctx)
+	case PauseScheduleMethod:
+		var paused bool
+		if err := actors.DecodeInternalActorRequest(data, &paused); err != nil {
+			return nil, fmt.Errorf("failed to decode PauseSchedule request: %w", err)
+		}
+		a.paused = paused
+		if !paused {
+			// A reminder that came due while paused was not re-registered,
+			// so resuming arms the next fire time again.
+			if err := a.scheduleNextReminder(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return nil, a.saveState(ctx)
+	case TriggerScheduleMethod:
+		if err := a.fire(ctx, time.Now()); err != nil {
+			return nil, err
+		}
+		return nil, a.saveState(ctx)
+	case DeleteScheduleMethod:
+		if err := a.actors.DeleteReminder(ctx, &actors.DeleteReminderRequest{
+			Name:      scheduleReminderName,
+			ActorType: ScheduleActorType,
+			ActorID:   a.scheduleID,
+		}); err != nil {
+			return nil, err
+		}
+		return nil, a.actors.TransactionalStateOperation(ctx, &actors.TransactionalRequest{
+			ActorType: ScheduleActorType,
+			ActorID:   a.scheduleID,
+			Operations: []actors.TransactionalOperation{
+				{Operation: actors.Delete, Request: actors.TransactionalDelete{Key: scheduleStateKey}},
+			},
+		})
+	case DescribeScheduleMethod:
+		return actors.EncodeInternalActorResponse(a.toMetadata())
+	default:
+		return nil, fmt.Errorf("no such method: %s", methodName)
+	}
+}
+
+// InvokeReminder implements actors.InternalActor. It's called when the
+// schedule's next fire time arrives. The reminder's data carries the fire
+// time it was scheduled for, encoded by scheduleNextReminder, so that a
+// reminder which fires late (e.g. because this actor only just reactivated
+// after being down) can be judged against the schedule's CatchupWindow
+// instead of always firing no matter how stale it is.
+func (a *scheduleActor) InvokeReminder(ctx context.Context, actorID, reminderName string, data []byte) error {
+	a.scheduleID = actorID
+	if reminderName != scheduleReminderName {
+		return nil
+	}
+	if err := a.loadState(ctx); err != nil {
+		return fmt.Errorf("failed to load schedule state: %w", err)
+	}
+	if a.paused {
+		return nil
+	}
+
+	scheduledFor := time.Now()
+	var reminderData struct {
+		ScheduledFor time.Time
+	}
+	if err := json.Unmarshal(data, &reminderData); err == nil && !reminderData.ScheduledFor.IsZero() {
+		scheduledFor = reminderData.ScheduledFor
+	}
+
+	if a.policy.CatchupWindow > 0 && time.Since(scheduledFor) > a.policy.CatchupWindow {
+		a.recordResult(ScheduleActionResult{FireTime: scheduledFor, Started: false, Err: "missed fire time dropped: older than CatchupWindow"})
+		if err := a.scheduleNextReminder(ctx); err != nil {
+			return err
+		}
+		return a.saveState(ctx)
+	}
+
+	if err := a.fire(ctx, scheduledFor); err != nil {
+		return err
+	}
+	return a.saveState(ctx)
+}
+
+// InvokeTimer implements actors.InternalActor. Schedules don't use timers.
+func (*scheduleActor) InvokeTimer(context.Context, string, string, []byte) error {
+	return nil
+}
+
+// DeactivateActor implements actors.InternalActor.
+func (*scheduleActor) DeactivateActor(context.Context) error {
+	return nil
+}
+
+// loadState refreshes the actor's in-memory fields from persisted actor
+// state. It's a no-op, leaving the zero-value fields in place, the first
+// time it's called for a schedule ID that has never been saved (i.e.
+// during the CreateSchedule call that establishes it).
+func (a *scheduleActor) loadState(ctx context.Context) error {
+	res, err := a.actors.GetState(ctx, &actors.GetStateRequest{
+		ActorType: ScheduleActorType,
+		ActorID:   a.scheduleID,
+		Key:       scheduleStateKey,
+	})
+	if err != nil {
+		return err
+	}
+	if res == nil || len(res.Data) == 0 {
+		return nil
+	}
+
+	var state scheduleState
+	if err := json.Unmarshal(res.Data, &state); err != nil {
+		return fmt.Errorf("failed to decode persisted schedule state: %w", err)
+	}
+	a.spec = state.Spec
+	a.policy = state.Policy
+	a.action = state.Action
+	a.paused = state.Paused
+	a.running = state.Running
+	a.results = state.Results
+	a.pending = state.Pending
+	return nil
+}
+
+// saveState persists the actor's in-memory fields, so a later activation of
+// this schedule ID, possibly on a different replica after this one was
+// deactivated, picks up exactly where this one left off.
+func (a *scheduleActor) saveState(ctx context.Context) error {
+	data, err := json.Marshal(scheduleState{
+		Spec:    a.spec,
+		Policy:  a.policy,
+		Action:  a.action,
+		Paused:  a.paused,
+		Running: a.running,
+		Results: a.results,
+		Pending: a.pending,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule state: %w", err)
+	}
+
+	return a.actors.TransactionalStateOperation(ctx, &actors.TransactionalRequest{
+		ActorType: ScheduleActorType,
+		ActorID:   a.scheduleID,
+		Operations: []actors.TransactionalOperation{
+			{Operation: actors.Upsert, Request: actors.TransactionalUpsert{Key: scheduleStateKey, Value: data}},
+		},
+	})
+}
+
+func (a *scheduleActor) create(ctx context.Context, req *CreateScheduleRequest) error {
+	a.spec = req.Spec
+	a.policy = req.Policy
+	a.action = req.Action
+	a.paused = false
+	return a.scheduleNextReminder(ctx)
+}
+
+func (a *scheduleActor) update(ctx context.Context, req *UpdateScheduleRequest) error {
+	if req.Spec != nil {
+		a.spec = *req.Spec
+	}
+	if req.Policy != nil {
+		a.policy = *req.Policy
+	}
+	if req.Action != nil {
+		a.action = *req.Action
+	}
+	return a.scheduleNextReminder(ctx)
+}
+
+// fire evaluates the overlap policy against the instances this actor
+// believes are still running, then starts the action's workflow if the
+// policy allows it. When the policy instead buffers the firing
+// (OverlapBufferOne, OverlapBufferAll), fire records it as pending and
+// drains the queue, oldest first, the next time a start is allowed.
+//
+// Overlap is rechecked before every single start, including between items
+// drained from the pending queue and the currently-arriving at: once a
+// start lands, overlapAllows() goes false again under
+// OverlapSkip/OverlapBufferOne/OverlapBufferAll (all three cap concurrency
+// at one running instance), so anything left in the queue -- pending
+// backlog or at itself -- goes back through bufferFire instead of starting
+// alongside it. The result of every fire time, started or not, is
+// recorded, and a start failure may pause the schedule per policy.
+func (a *scheduleActor) fire(ctx context.Context, at time.Time) error {
+	a.reapCompletedInstances(ctx)
+
+	if a.policy.Overlap == OverlapCancelOther {
+		for _, id := range a.running {
+			_ = a.terminateInstance(ctx, id)
+		}
+		a.running = nil
+	}
+
+	queue := append(a.pending, at)
+	a.pending = nil
+	for _, firingAt := range queue {
+		if !a.overlapAllows() {
+			a.bufferFire(firingAt)
+			a.recordResult(ScheduleActionResult{FireTime: firingAt, Started: false})
+			continue
+		}
+		a.startAndRecord(ctx, firingAt)
+	}
+
+	return a.scheduleNextReminder(ctx)
+}
+
+// bufferFire records a blocked firing as pending, per the overlap policy.
+// OverlapSkip drops it outright; OverlapBufferOne keeps at most the single
+// oldest pending firing; OverlapBufferAll keeps every one, in order.
+func (a *scheduleActor) bufferFire(at time.Time) {
+	switch a.policy.Overlap {
+	case OverlapBufferOne:
+		if len(a.pending) == 0 {
+			a.pending = []time.Time{at}
+		}
+	case OverlapBufferAll:
+		a.pending = append(a.pending, at)
+	}
+}
+
+// startAndRecord starts the action's workflow for a single fire time and
+// records the result, tracking the new instance as running on success.
+func (a *scheduleActor) startAndRecord(ctx context.Context, at time.Time) {
+	instanceID := api.InstanceID(fmt.Sprintf("%s-%s", a.action.InstanceIDPrefix, uuid.NewString()))
+	err := a.startWorkflow(ctx, instanceID)
+	result := ScheduleActionResult{FireTime: at, InstanceID: instanceID, Started: err == nil}
+	if err != nil {
+		result.Err = err.Error()
+		if a.policy.PauseOnFailure {
+			a.paused = true
+		}
+	} else {
+		a.running = append(a.running, instanceID)
+	}
+	a.recordResult(result)
+}
+
+// overlapAllows reports whether the overlap policy permits starting another
+// instance right now, given what's currently tracked as running.
+// OverlapCancelOther and OverlapAllowAll always allow a start (the former
+// after terminating whatever's running); every other policy, including the
+// two buffering policies, only allows a start once nothing is running --
+// the difference between them is what happens to a blocked firing, decided
+// by bufferFire.
+func (a *scheduleActor) overlapAllows() bool {
+	switch a.policy.Overlap {
+	case OverlapCancelOther, OverlapAllowAll:
+		return true
+	default:
+		return len(a.running) == 0
+	}
+}
+
+// startWorkflow creates a new orchestration instance for the schedule's
+// action by invoking the workflow actor the same way
+// actorBackend.CreateOrchestrationInstance does.
+func (a *scheduleActor) startWorkflow(ctx context.Context, instanceID api.InstanceID) error {
+	startEvent := backend.NewExecutionStartedEvent(
+		-1,
+		a.action.OrchestrationName,
+		string(instanceID),
+		wrapperspb.String(a.action.Input),
+		nil,
+		nil,
+	)
+	eventData, err := backend.MarshalHistoryEvent(startEvent)
+	if err != nil {
+		return err
+	}
+
+	req := invokev1.
+		NewInvokeMethodRequest(CreateWorkflowInstanceMethod).
+		WithActor(WorkflowActorType, string(instanceID)).
+		WithRawData(eventData, invokev1.OctetStreamContentType)
+	_, err = a.actors.Call(ctx, req)
+	return err
+}
+
+// terminateInstance best-effort terminates a previously-started instance;
+// failures are ignored since the instance may have already completed.
+func (a *scheduleActor) terminateInstance(ctx context.Context, id api.InstanceID) error {
+	terminateEvent := backend.NewExecutionTerminatedEvent(wrapperspb.String("superseded by schedule"))
+	eventData, err := backend.MarshalHistoryEvent(terminateEvent)
+	if err != nil {
+		return err
+	}
+	req := invokev1.
+		NewInvokeMethodRequest(AddWorkflowEventMethod).
+		WithActor(WorkflowActorType, string(id)).
+		WithRawData(eventData, invokev1.OctetStreamContentType)
+	_, err = a.actors.Call(ctx, req)
+	return err
+}
+
+// reapCompletedInstances drops instances from a.running whose
+// GetOrchestrationMetadata reports a terminal status.
+func (a *scheduleActor) reapCompletedInstances(ctx context.Context) {
+	still := a.running[:0]
+	for _, id := range a.running {
+		req := invokev1.
+			NewInvokeMethodRequest(GetWorkflowMetadataMethod).
+			WithActor(WorkflowActorType, string(id)).
+			WithRawData(nil, invokev1.OctetStreamContentType)
+		res, err := a.actors.Call(ctx, req)
+		if err != nil {
+			continue
+		}
+		_, data := res.RawData()
+		var metadata api.OrchestrationMetadata
+		if err := actors.DecodeInternalActorResponse(data, &metadata); err != nil {
+			continue
+		}
+		if !metadata.IsComplete() {
+			still = append(still, id)
+		}
+	}
+	a.running = still
+}
+
+func (a *scheduleActor) recordResult(result ScheduleActionResult) {
+	a.results = append([]ScheduleActionResult{result}, a.results...)
+	if len(a.results) > maxRecentResults {
+		a.results = a.results[:maxRecentResults]
+	}
+}
+
+// scheduleNextReminder computes the next fire time from the spec and
+// re-registers the actor's single reminder. If the spec yields no future
+// fire time (e.g. EndAt has passed), the existing reminder is deleted
+// instead.
+func (a *scheduleActor) scheduleNextReminder(ctx context.Context) error {
+	next, ok := a.nextFireTime(time.Now())
+	if !ok {
+		return a.actors.DeleteReminder(ctx, &actors.DeleteReminderRequest{
+			Name:      scheduleReminderName,
+			ActorType: ScheduleActorType,
+			ActorID:   a.scheduleID,
+		})
+	}
+
+	dueTime := time.Until(next)
+	if a.spec.Jitter > 0 {
+		dueTime += time.Duration(rand.Int63n(int64(a.spec.Jitter) + 1))
+	}
+
+	reminderData, err := json.Marshal(struct{ ScheduledFor time.Time }{ScheduledFor: next})
+	if err != nil {
+		return fmt.Errorf("failed to encode reminder data: %w", err)
+	}
+
+	return a.actors.CreateReminder(ctx, &actors.CreateReminderRequest{
+		Name:      scheduleReminderName,
+		ActorType: ScheduleActorType,
+		ActorID:   a.scheduleID,
+		DueTime:   dueTime.String(),
+		Data:      reminderData,
+	})
+}
+
+// nextFireTime merges the fire times implied by CronExpressions and
+// Intervals and returns the earliest one after now, bounded by StartAt and
+// EndAt.
+func (a *scheduleActor) nextFireTime(now time.Time) (time.Time, bool) {
+	if a.spec.EndAt != nil && now.After(*a.spec.EndAt) {
+		return time.Time{}, false
+	}
+
+	loc := time.UTC
+	if a.spec.Timezone != "" {
+		if parsed, err := time.LoadLocation(a.spec.Timezone); err == nil {
+			loc = parsed
+		}
+	}
+
+	var earliest time.Time
+	found := false
+	consider := func(t time.Time) {
+		if !found || t.Before(earliest) {
+			earliest = t
+			found = true
+		}
+	}
+
+	cronFrom := now
+	if a.spec.StartAt != nil && a.spec.StartAt.After(now) {
+		cronFrom = *a.spec.StartAt
+	}
+	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+	for _, expr := range a.spec.CronExpressions {
+		schedule, err := parser.Parse(expr)
+		if err != nil {
+			continue
+		}
+		consider(schedule.Next(cronFrom.In(loc)))
+	}
+
+	for _, interval := range a.spec.Intervals {
+		if interval <= 0 {
+			continue
+		}
+		// The grid is anchored at StartAt itself, not at whichever instant
+		// this function happens to be evaluated at -- including when
+		// StartAt is already in the past, which is the common case once a
+		// schedule has been running a while. A fixed anchor is what makes
+		// the grid stable across calls: two calls with different now
+		// values (e.g. a reminder firing on time vs. one that fired late
+		// and was evaluated against CatchupWindow) land on the exact same
+		// sequence of fire times instead of each one starting a fresh
+		// fixed-delay count from its own now.
+		base := now
+		if a.spec.StartAt != nil {
+			base = *a.spec.StartAt
+		}
+		if base.After(now) {
+			consider(base)
+			continue
+		}
+		elapsed := now.Sub(base)
+		periods := elapsed/interval + 1
+		consider(base.Add(periods * interval))
+	}
+
+	if !found {
+		return time.Time{}, false
+	}
+	if a.spec.EndAt != nil && earliest.After(*a.spec.EndAt) {
+		return time.Time{}, false
+	}
+	return earliest, true
+}
+
+func (a *scheduleActor) toMetadata() *ScheduleMetadata {
+	var next *time.Time
+	if t, ok := a.nextFireTime(time.Now()); ok {
+		next = &t
+	}
+	return &ScheduleMetadata{
+		ScheduleID:       a.scheduleID,
+		Spec:             a.spec,
+		Policy:           a.policy,
+		Action:           a.action,
+		Paused:           a.paused,
+		NextFireTime:     next,
+		RunningInstances: a.running,
+		RecentResults:    a.results,
+	}
+}
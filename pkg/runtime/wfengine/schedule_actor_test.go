@@ -0,0 +1,135 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/microsoft/durabletask-go/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextFireTime_MergesCronAndIntervalSources(t *testing.T) {
+	now := time.Date(2026, 7, 25, 12, 0, 0, 0, time.UTC)
+
+	a := &scheduleActor{spec: ScheduleSpec{
+		// Fires at the top of every hour...
+		CronExpressions: []string{"0 * * * *"},
+		// ...and every 5 minutes, which is always the sooner of the two.
+		Intervals: []time.Duration{5 * time.Minute},
+	}}
+
+	next, ok := a.nextFireTime(now)
+	require.True(t, ok)
+	assert.Equal(t, now.Add(5*time.Minute), next)
+}
+
+func TestNextFireTime_IntervalsStayAnchoredToPastStartAt(t *testing.T) {
+	startAt := time.Date(2026, 7, 25, 9, 0, 0, 0, time.UTC)
+	// 9:00 + 3*5m = 9:15, which is before "now" (9:17); the next grid point
+	// after 9:17 is 9:00 + 4*5m = 9:20.
+	now := startAt.Add(17 * time.Minute)
+
+	a := &scheduleActor{spec: ScheduleSpec{
+		Intervals: []time.Duration{5 * time.Minute},
+		StartAt:   &startAt,
+	}}
+
+	next, ok := a.nextFireTime(now)
+	require.True(t, ok)
+	assert.Equal(t, startAt.Add(20*time.Minute), next)
+
+	// Evaluating again later, as if this fire time had been dropped by
+	// CatchupWindow and re-evaluated after a delay, must land on the exact
+	// same grid point rather than restarting a fixed-delay count from the
+	// new, later now.
+	later := now.Add(2 * time.Minute)
+	next2, ok := a.nextFireTime(later)
+	require.True(t, ok)
+	assert.Equal(t, next, next2)
+}
+
+func TestNextFireTime_RespectsEndAt(t *testing.T) {
+	now := time.Date(2026, 7, 25, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+
+	a := &scheduleActor{spec: ScheduleSpec{
+		Intervals: []time.Duration{time.Minute},
+		EndAt:     &past,
+	}}
+
+	_, ok := a.nextFireTime(now)
+	assert.False(t, ok)
+}
+
+func TestNextFireTime_NoSourcesYieldsNoFireTime(t *testing.T) {
+	a := &scheduleActor{}
+	_, ok := a.nextFireTime(time.Now())
+	assert.False(t, ok)
+}
+
+func TestOverlapAllows_PerPolicy(t *testing.T) {
+	cases := []struct {
+		name        string
+		policy      OverlapPolicy
+		running     []api.InstanceID
+		wantAllowed bool
+	}{
+		{"skip, nothing running", OverlapSkip, nil, true},
+		{"skip, one running", OverlapSkip, []api.InstanceID{"a"}, false},
+		{"buffer-one, one running", OverlapBufferOne, []api.InstanceID{"a"}, false},
+		{"buffer-all, one running", OverlapBufferAll, []api.InstanceID{"a"}, false},
+		{"cancel-other, one running", OverlapCancelOther, []api.InstanceID{"a"}, true},
+		{"allow-all, one running", OverlapAllowAll, []api.InstanceID{"a"}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := &scheduleActor{policy: SchedulePolicy{Overlap: c.policy}, running: c.running}
+			assert.Equal(t, c.wantAllowed, a.overlapAllows())
+		})
+	}
+}
+
+func TestBufferFire_OneKeepsOnlyTheOldestPending(t *testing.T) {
+	a := &scheduleActor{policy: SchedulePolicy{Overlap: OverlapBufferOne}}
+	t1 := time.Now()
+	t2 := t1.Add(time.Minute)
+
+	a.bufferFire(t1)
+	a.bufferFire(t2)
+
+	require.Len(t, a.pending, 1)
+	assert.Equal(t, t1, a.pending[0])
+}
+
+func TestBufferFire_AllKeepsEveryPendingInOrder(t *testing.T) {
+	a := &scheduleActor{policy: SchedulePolicy{Overlap: OverlapBufferAll}}
+	t1 := time.Now()
+	t2 := t1.Add(time.Minute)
+
+	a.bufferFire(t1)
+	a.bufferFire(t2)
+
+	require.Len(t, a.pending, 2)
+	assert.Equal(t, []time.Time{t1, t2}, a.pending)
+}
+
+func TestBufferFire_SkipNeverBuffers(t *testing.T) {
+	a := &scheduleActor{policy: SchedulePolicy{Overlap: OverlapSkip}}
+	a.bufferFire(time.Now())
+	assert.Empty(t, a.pending)
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dapr/dapr/pkg/actors"
+)
+
+// ScheduleRegistryActorType is the well-known actor type for the single,
+// singleton actor that tracks every schedule ID that currently exists. The
+// actor runtime has no native way to enumerate the actors of a given type,
+// so ListSchedules is served from this registry instead of a scan.
+const ScheduleRegistryActorType = "dapr.internal.wfengine.scheduleregistry"
+
+// scheduleRegistryActorID is the fixed, singleton actor ID the registry is
+// always addressed under.
+const scheduleRegistryActorID = "registry"
+
+// scheduleRegistryStateKey is the actor-state key the registry persists its
+// tracked schedule IDs under.
+const scheduleRegistryStateKey = "schedule-registry-state"
+
+const (
+	registerScheduleMethod   = "RegisterSchedule"
+	unregisterScheduleMethod = "UnregisterSchedule"
+	listScheduleIDsMethod    = "ListScheduleIDs"
+)
+
+// registerScheduleRequest is the payload for registerScheduleMethod.
+type registerScheduleRequest struct {
+	ScheduleID        string
+	OrchestrationName string
+}
+
+// scheduleRegistryActor is the internal actor implementation backing
+// ScheduleRegistryActorType. It persists a flat map of every known schedule
+// ID to the workflow function name its action targets, so ListSchedules can
+// filter by OrchestrationName without loading every schedule.
+type scheduleRegistryActor struct {
+	actors actors.Actors
+
+	// schedules maps schedule ID to the OrchestrationName of its action.
+	schedules map[string]string
+}
+
+func newScheduleRegistryActor() *scheduleRegistryActor {
+	return &scheduleRegistryActor{}
+}
+
+// SetActorRuntime implements actors.InternalActor.
+func (a *scheduleRegistryActor) SetActorRuntime(runtime actors.Actors) {
+	a.actors = runtime
+}
+
+// InvokeMethod implements actors.InternalActor.
+func (a *scheduleRegistryActor) InvokeMethod(ctx context.Context, actorID, methodName string, data []byte) ([]byte, error) {
+	if err := a.loadState(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load schedule registry state: %w", err)
+	}
+
+	switch methodName {
+	case registerScheduleMethod:
+		var req registerScheduleRequest
+		if err := actors.DecodeInternalActorRequest(data, &req); err != nil {
+			return nil, fmt.Errorf("failed to decode RegisterSchedule request: %w", err)
+		}
+		if a.schedules == nil {
+			a.schedules = make(map[string]string)
+		}
+		a.schedules[req.ScheduleID] = req.OrchestrationName
+		return nil, a.saveState(ctx)
+	case unregisterScheduleMethod:
+		var scheduleID string
+		if err := actors.DecodeInternalActorRequest(data, &scheduleID); err != nil {
+			return nil, fmt.Errorf("failed to decode UnregisterSchedule request: %w", err)
+		}
+		delete(a.schedules, scheduleID)
+		return nil, a.saveState(ctx)
+	case listScheduleIDsMethod:
+		var filter ListSchedulesFilter
+		if err := actors.DecodeInternalActorRequest(data, &filter); err != nil {
+			return nil, fmt.Errorf("failed to decode ListSchedules filter: %w", err)
+		}
+		var ids []string
+		for id, orchestrationName := range a.schedules {
+			if filter.OrchestrationName != "" && filter.OrchestrationName != orchestrationName {
+				continue
+			}
+			ids = append(ids, id)
+		}
+		return actors.EncodeInternalActorResponse(ids)
+	default:
+		return nil, fmt.Errorf("no such method: %s", methodName)
+	}
+}
+
+// InvokeReminder implements actors.InternalActor. The registry uses no
+// reminders.
+func (*scheduleRegistryActor) InvokeReminder(context.Context, string, string, []byte) error {
+	return nil
+}
+
+// InvokeTimer implements actors.InternalActor. The registry uses no timers.
+func (*scheduleRegistryActor) InvokeTimer(context.Context, string, string, []byte) error {
+	return nil
+}
+
+// DeactivateActor implements actors.InternalActor.
+func (*scheduleRegistryActor) DeactivateActor(context.Context) error {
+	return nil
+}
+
+func (a *scheduleRegistryActor) loadState(ctx context.Context) error {
+	res, err := a.actors.GetState(ctx, &actors.GetStateRequest{
+		ActorType: ScheduleRegistryActorType,
+		ActorID:   scheduleRegistryActorID,
+		Key:       scheduleRegistryStateKey,
+	})
+	if err != nil {
+		return err
+	}
+	if res == nil || len(res.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(res.Data, &a.schedules)
+}
+
+func (a *scheduleRegistryActor) saveState(ctx context.Context) error {
+	data, err := json.Marshal(a.schedules)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule registry state: %w", err)
+	}
+	return a.actors.TransactionalStateOperation(ctx, &actors.TransactionalRequest{
+		ActorType: ScheduleRegistryActorType,
+		ActorID:   scheduleRegistryActorID,
+		Operations: []actors.TransactionalOperation{
+			{Operation: actors.Upsert, Request: actors.TransactionalUpsert{Key: scheduleRegistryStateKey, Value: data}},
+		},
+	})
+}
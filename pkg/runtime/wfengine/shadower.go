@@ -0,0 +1,321 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microsoft/durabletask-go/api"
+	"github.com/microsoft/durabletask-go/backend"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// GetOrchestrationHistory implements a capability alternate backends may
+// choose to support: returning the raw, ordered history of a completed or
+// running orchestration instance, independent of the replayed
+// OrchestrationMetadata view GetOrchestrationMetadata returns. The
+// Shadower uses this to re-drive a candidate worker against real history
+// without that worker producing any external side effects.
+func (be *actorBackend) GetOrchestrationHistory(ctx context.Context, id api.InstanceID) ([]*backend.HistoryEvent, error) {
+	return be.getOrchestrationHistory(ctx, id)
+}
+
+// HistorySource is implemented by backends that can enumerate and return
+// raw orchestration history, which the Shadower needs but backend.Backend
+// itself doesn't require.
+type HistorySource interface {
+	// GetOrchestrationHistory returns the raw history events recorded for
+	// id, in the order they occurred.
+	GetOrchestrationHistory(ctx context.Context, id api.InstanceID) ([]*backend.HistoryEvent, error)
+
+	// ListInstanceIDs streams instance IDs matching query to out, closing
+	// out when done or when ctx is canceled. It's intentionally narrow so
+	// that history stores without a rich query capability (e.g. a plain
+	// key/value store scanning by key prefix) can still implement it.
+	ListInstanceIDs(ctx context.Context, query ShadowScanQuery, out chan<- api.InstanceID) error
+}
+
+// ShadowScanQuery narrows which instances a Shadower run replays.
+type ShadowScanQuery struct {
+	// InstanceIDPrefix, if non-empty, restricts the scan to instance IDs
+	// starting with this prefix.
+	InstanceIDPrefix string
+	// WorkflowType, if non-empty, restricts the scan to instances of this
+	// registered workflow function name.
+	WorkflowType string
+	// StatusFilter, if non-empty, restricts the scan to instances whose
+	// last known runtime status matches (e.g. "COMPLETED", "FAILED").
+	StatusFilter string
+	// TimeStart and TimeEnd bound the scan to instances created within
+	// this window. A zero value leaves that side of the window open.
+	TimeStart time.Time
+	TimeEnd   time.Time
+	// SamplingRate, in the range (0, 1], is the fraction of matching
+	// instances to actually replay; 1 replays every match.
+	SamplingRate float64
+	// Concurrency bounds how many instances are replayed at once. A value
+	// of 0 defaults to 1.
+	Concurrency int
+	// Components names the HistorySource/ShadowReplayer pair, registered
+	// with RegisterShadowComponents, that a shadow-scan workflow running
+	// this query replays against. It's part of the query specifically so
+	// that RunAsWorkflow can rebuild a Shadower from nothing but this
+	// (serializable) struct after a reactivation, rather than depending on
+	// an in-memory handle created by whoever first submitted the scan.
+	Components string
+}
+
+// ShadowResult records the outcome of replaying a single instance.
+type ShadowResult struct {
+	InstanceID api.InstanceID
+	// Nondeterministic is true when replay produced a different sequence
+	// of commands than the recorded history, which almost always indicates
+	// the candidate worker's workflow code is no longer a safe, backward
+	// compatible replay of history generated by an older version.
+	Nondeterministic bool
+	// VersionIncompatible is true when the candidate worker has no
+	// registered function for the instance's workflow type at all.
+	VersionIncompatible bool
+	// Mismatches describes, in order, every point where the replayed
+	// command stream diverged from the recorded history. Empty when
+	// Nondeterministic and VersionIncompatible are both false.
+	Mismatches []string
+	// Err holds any error encountered while loading or replaying the
+	// instance that isn't itself a nondeterminism finding.
+	Err error
+}
+
+// ShadowReplayer drives one history through a candidate worker's executor
+// in replay-only mode and reports whether the replay matched. It's
+// satisfied by the engine's local task executor; kept as an interface here
+// so the shadower doesn't import the executor package directly and can be
+// exercised with a fake in tests.
+type ShadowReplayer interface {
+	// Replay feeds history through the candidate worker's registered
+	// workflow function for workflowType without performing any actual
+	// activity invocations, timers, or external calls, and reports any
+	// divergence from the recorded command stream.
+	Replay(ctx context.Context, workflowType string, history []*backend.HistoryEvent) (mismatches []string, versionIncompatible bool, err error)
+}
+
+// Shadower replays completed (or in-progress) orchestration histories
+// against a candidate worker without producing any external side effects,
+// so operators can validate a new build before rolling it out. It's
+// modeled on Cadence's workflow shadower.
+type Shadower struct {
+	source   HistorySource
+	replayer ShadowReplayer
+	query    ShadowScanQuery
+
+	mu      sync.Mutex
+	results []ShadowResult
+}
+
+// NewShadower creates a Shadower that reads instance histories from source
+// and replays them with replayer, restricted to query.
+func NewShadower(source HistorySource, replayer ShadowReplayer, query ShadowScanQuery) *Shadower {
+	if query.Concurrency <= 0 {
+		query.Concurrency = 1
+	}
+	if query.SamplingRate <= 0 || query.SamplingRate > 1 {
+		query.SamplingRate = 1
+	}
+	return &Shadower{source: source, replayer: replayer, query: query}
+}
+
+// Run streams matching instance IDs from the configured source and drives
+// each one's history through the replayer, bounded by query.Concurrency. It
+// blocks until every matching instance has been replayed or ctx is
+// canceled, and returns the accumulated results.
+//
+// Run itself is a plain, non-durable method call: a process restart partway
+// through a large scan loses progress. RegisterShadowScan/RunAsWorkflow
+// below wrap it as a durable workflow so a long scan survives that.
+func (s *Shadower) Run(ctx context.Context) ([]ShadowResult, error) {
+	ids := make(chan api.InstanceID)
+	scanErrCh := make(chan error, 1)
+	go func() {
+		scanErrCh <- s.source.ListInstanceIDs(ctx, s.query, ids)
+	}()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.query.Concurrency)
+	for id := range ids {
+		if s.query.SamplingRate < 1 && rand.Float64() > s.query.SamplingRate {
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(id api.InstanceID) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.replayOne(ctx, id)
+		}(id)
+	}
+	wg.Wait()
+
+	if err := <-scanErrCh; err != nil {
+		return s.snapshotResults(), fmt.Errorf("instance scan failed: %w", err)
+	}
+	return s.snapshotResults(), nil
+}
+
+func (s *Shadower) replayOne(ctx context.Context, id api.InstanceID) {
+	result := ShadowResult{InstanceID: id}
+
+	history, err := s.source.GetOrchestrationHistory(ctx, id)
+	if err != nil {
+		result.Err = err
+		s.appendResult(result)
+		return
+	}
+
+	workflowType := workflowTypeFromHistory(history)
+	mismatches, versionIncompatible, err := s.replayer.Replay(ctx, workflowType, history)
+	if err != nil {
+		result.Err = err
+	}
+	result.Mismatches = mismatches
+	result.Nondeterministic = len(mismatches) > 0
+	result.VersionIncompatible = versionIncompatible
+	s.appendResult(result)
+}
+
+func (s *Shadower) appendResult(r ShadowResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, r)
+}
+
+func (s *Shadower) snapshotResults() []ShadowResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]ShadowResult, len(s.results))
+	copy(out, s.results)
+	return out
+}
+
+// workflowTypeFromHistory extracts the registered workflow function name
+// from a history's ExecutionStartedEvent, which is always the first event
+// in a well-formed history.
+func workflowTypeFromHistory(history []*backend.HistoryEvent) string {
+	for _, e := range history {
+		if es := e.GetExecutionStarted(); es != nil {
+			return es.GetName()
+		}
+	}
+	return ""
+}
+
+// ShadowWorkflowName is the registered workflow function name used to drive
+// a Shadower scan as a durable, long-running workflow of its own, so the
+// scan survives a process restart partway through a large history store.
+// RunAsWorkflow is the function registered under this name.
+const ShadowWorkflowName = "dapr.internal.wfengine.ShadowScan"
+
+// ShadowWorkflowInstanceID derives a deterministic instance ID for a shadow
+// scan workflow so that re-submitting the same query resumes rather than
+// duplicates it.
+func ShadowWorkflowInstanceID(query ShadowScanQuery) api.InstanceID {
+	return api.InstanceID(fmt.Sprintf("shadow-%s-%s", query.WorkflowType, strings.ReplaceAll(query.InstanceIDPrefix, "/", "-")))
+}
+
+// shadowComponentPair is the non-serializable half of a shadow scan: the
+// HistorySource and ShadowReplayer a query replays against.
+type shadowComponentPair struct {
+	source   HistorySource
+	replayer ShadowReplayer
+}
+
+// shadowComponents holds every HistorySource/ShadowReplayer pair registered
+// with RegisterShadowComponents, keyed by name. Unlike a Shadower itself,
+// these are meant to be registered once at process startup -- the same
+// lifecycle as RegisterBackend -- so they're already present under the same
+// name on every replica by the time any shadow-scan workflow instance
+// reactivates and needs one, including after a process restart.
+var (
+	shadowComponentsMu sync.Mutex
+	shadowComponents   = map[string]shadowComponentPair{}
+)
+
+// RegisterShadowComponents registers the HistorySource/ShadowReplayer pair
+// that RunAsWorkflow uses for any ShadowScanQuery whose Components field
+// equals name. Call it once per process, during startup, before any
+// shadow-scan workflow can reactivate and need it.
+func RegisterShadowComponents(name string, source HistorySource, replayer ShadowReplayer) {
+	shadowComponentsMu.Lock()
+	defer shadowComponentsMu.Unlock()
+	shadowComponents[name] = shadowComponentPair{source: source, replayer: replayer}
+}
+
+// RegisterShadowScan starts query as a durable shadow-scan workflow
+// instance, the same way any other workflow instance is created, under the
+// deterministic ID from ShadowWorkflowInstanceID(query). Submitting the
+// same query again resumes the existing instance instead of starting a
+// duplicate scan. query.Components must already be registered with
+// RegisterShadowComponents.
+//
+// The caller is responsible for registering RunAsWorkflow under
+// ShadowWorkflowName with the engine's workflow function table, the same
+// way any other workflow function is registered; exposing this over the
+// workflow gRPC/HTTP API is part of that same outer wiring and isn't
+// implemented in this package.
+func RegisterShadowScan(ctx context.Context, be *actorBackend, query ShadowScanQuery) (api.InstanceID, error) {
+	id := ShadowWorkflowInstanceID(query)
+
+	input, err := json.Marshal(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode shadow scan query: %w", err)
+	}
+
+	startEvent := backend.NewExecutionStartedEvent(-1, ShadowWorkflowName, string(id), wrapperspb.String(string(input)), nil, nil)
+	if err := be.CreateOrchestrationInstance(ctx, startEvent); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// RunAsWorkflow is the orchestration function registered under
+// ShadowWorkflowName. Its workflow input is the JSON-encoded ShadowScanQuery
+// RegisterShadowScan submitted; RunAsWorkflow decodes it, looks up the
+// HistorySource/ShadowReplayer pair named by query.Components, and rebuilds
+// a Shadower to drive to completion. Because every dependency is either
+// carried in the durable workflow input or already registered process-wide
+// under a well-known name, this reconstruction succeeds the same way
+// regardless of which replica's actor runtime reactivates the instance, so
+// a shadow scan over a large history store survives both a process restart
+// and an ordinary actor deactivation/reactivation partway through.
+func RunAsWorkflow(ctx context.Context, input []byte) ([]ShadowResult, error) {
+	var query ShadowScanQuery
+	if err := json.Unmarshal(input, &query); err != nil {
+		return nil, fmt.Errorf("failed to decode shadow scan query: %w", err)
+	}
+
+	shadowComponentsMu.Lock()
+	pair, ok := shadowComponents[query.Components]
+	shadowComponentsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no shadow scan components registered under name %q", query.Components)
+	}
+
+	return NewShadower(pair.source, pair.replayer, query).Run(ctx)
+}
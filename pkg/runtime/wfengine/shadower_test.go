@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The Dapr Authors
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wfengine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/microsoft/durabletask-go/api"
+	"github.com/microsoft/durabletask-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHistorySource struct {
+	ids       []api.InstanceID
+	scanErr   error
+	histories map[api.InstanceID][]*backend.HistoryEvent
+}
+
+func (f *fakeHistorySource) ListInstanceIDs(ctx context.Context, query ShadowScanQuery, out chan<- api.InstanceID) error {
+	defer close(out)
+	for _, id := range f.ids {
+		select {
+		case out <- id:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return f.scanErr
+}
+
+func (f *fakeHistorySource) GetOrchestrationHistory(ctx context.Context, id api.InstanceID) ([]*backend.HistoryEvent, error) {
+	return f.histories[id], nil
+}
+
+type fakeReplayer struct {
+	mismatchesByType map[string][]string
+}
+
+func (f *fakeReplayer) Replay(ctx context.Context, workflowType string, history []*backend.HistoryEvent) ([]string, bool, error) {
+	return f.mismatchesByType[workflowType], false, nil
+}
+
+func TestShadower_RunReplaysEveryMatchingInstance(t *testing.T) {
+	source := &fakeHistorySource{
+		ids: []api.InstanceID{"a", "b"},
+		histories: map[api.InstanceID][]*backend.HistoryEvent{
+			"a": {backend.NewExecutionStartedEvent(0, "GoodWorkflow", "a", nil, nil, nil)},
+			"b": {backend.NewExecutionStartedEvent(0, "DriftedWorkflow", "b", nil, nil, nil)},
+		},
+	}
+	replayer := &fakeReplayer{mismatchesByType: map[string][]string{
+		"DriftedWorkflow": {"command 2: expected CallActivity, got CreateTimer"},
+	}}
+
+	s := NewShadower(source, replayer, ShadowScanQuery{})
+	results, err := s.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	byID := map[api.InstanceID]ShadowResult{}
+	for _, r := range results {
+		byID[r.InstanceID] = r
+	}
+	assert.False(t, byID["a"].Nondeterministic)
+	assert.True(t, byID["b"].Nondeterministic)
+	assert.Equal(t, []string{"command 2: expected CallActivity, got CreateTimer"}, byID["b"].Mismatches)
+}
+
+func TestShadowWorkflowInstanceID_IsDeterministic(t *testing.T) {
+	q := ShadowScanQuery{WorkflowType: "OrderWorkflow", InstanceIDPrefix: "orders/2024"}
+	assert.Equal(t, ShadowWorkflowInstanceID(q), ShadowWorkflowInstanceID(q))
+}
+
+func TestRunAsWorkflow_UnknownComponentsErrors(t *testing.T) {
+	input, err := json.Marshal(ShadowScanQuery{Components: "never-registered"})
+	require.NoError(t, err)
+
+	_, err = RunAsWorkflow(context.Background(), input)
+	assert.Error(t, err)
+}
+
+func TestRunAsWorkflow_RebuildsShadowerFromRegisteredComponents(t *testing.T) {
+	source := &fakeHistorySource{
+		ids: []api.InstanceID{"a"},
+		histories: map[api.InstanceID][]*backend.HistoryEvent{
+			"a": {backend.NewExecutionStartedEvent(0, "GoodWorkflow", "a", nil, nil, nil)},
+		},
+	}
+	replayer := &fakeReplayer{}
+	RegisterShadowComponents("test-components", source, replayer)
+
+	input, err := json.Marshal(ShadowScanQuery{Components: "test-components"})
+	require.NoError(t, err)
+
+	results, err := RunAsWorkflow(context.Background(), input)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, api.InstanceID("a"), results[0].InstanceID)
+}